@@ -31,6 +31,7 @@ import (
 	openapiproto "k8s.io/kube-openapi/pkg/util/proto"
 	"sigs.k8s.io/structured-merge-diff/fieldpath"
 	"sigs.k8s.io/structured-merge-diff/merge"
+	"sigs.k8s.io/structured-merge-diff/typed"
 	"sigs.k8s.io/yaml"
 )
 
@@ -45,15 +46,53 @@ type FieldManager interface {
 	// Apply is used when server-side apply is called, as it merges the
 	// object and update the managed fields.
 	Apply(liveObj runtime.Object, patch []byte, fieldManager string, force bool) (runtime.Object, error)
+
+	// ApplyDryRun performs the same merge and conflict computation as
+	// Apply, but never mutates the live object: it returns the object as
+	// it would look after the apply together with a diff describing which
+	// managers would gain or lose ownership of which fields. Callers can
+	// use this to preview ownership changes, or detect immutable-field
+	// mutations, before committing an apply.
+	ApplyDryRun(liveObj runtime.Object, patch []byte, fieldManager string, force bool) (runtime.Object, ManagedFieldsDiff, error)
+
+	// ApplyToScale is like Apply, but for a FieldManager created with
+	// NewScaleFieldManager: parentManagedFields is the managedFields
+	// currently recorded on the owning resource, and the returned
+	// internal.Metadata (fields and per-manager timestamps alike) is what
+	// should be written back onto it alongside the merged Scale object. It
+	// returns an error for a FieldManager not created with
+	// NewScaleFieldManager.
+	ApplyToScale(liveObj runtime.Object, patch []byte, fieldManager string, force bool, parentManagedFields internal.Metadata) (runtime.Object, internal.Metadata, error)
+}
+
+// ManagedFieldsDiff describes, on a per-manager basis, the fields that an
+// apply would give a manager ownership of (Added) and the fields a manager
+// would lose ownership of (Removed), whether or not another manager takes
+// them over. It is computed but never persisted: it only
+// exists to let callers preview an apply's effect on ownership.
+type ManagedFieldsDiff struct {
+	// Added maps a field manager identifier to the set of fields it would
+	// gain ownership of if the apply were committed.
+	Added map[string]*fieldpath.Set
+	// Removed maps a field manager identifier to the set of fields it
+	// would lose ownership of if the apply were committed.
+	Removed map[string]*fieldpath.Set
 }
 
 type fieldManager struct {
-	typeConverter   internal.TypeConverter
-	objectConverter runtime.ObjectConvertor
-	objectDefaulter runtime.ObjectDefaulter
-	groupVersion    schema.GroupVersion
-	hubVersion      schema.GroupVersion
-	updater         merge.Updater
+	typeConverter      internal.TypeConverter
+	objectConverter    runtime.ObjectConvertor
+	objectDefaulter    runtime.ObjectDefaulter
+	groupVersion       schema.GroupVersion
+	hubVersion         schema.GroupVersion
+	updater            merge.Updater
+	subresource        string
+	managedFieldsStore ManagedFieldsStore
+	// scaleParentGVK is set by NewScaleFieldManager to the GVK of the
+	// resource this FieldManager's /scale is a subresource of, so that
+	// ApplyToScale knows what to translate ownership to and from. Zero for
+	// a FieldManager not created by NewScaleFieldManager.
+	scaleParentGVK schema.GroupVersionKind
 }
 
 var _ FieldManager = &fieldManager{}
@@ -61,6 +100,34 @@ var _ FieldManager = &fieldManager{}
 // NewFieldManager creates a new FieldManager that merges apply requests
 // and update managed fields for other types of requests.
 func NewFieldManager(models openapiproto.Models, objectConverter runtime.ObjectConvertor, objectDefaulter runtime.ObjectDefaulter, gv schema.GroupVersion, hub schema.GroupVersion) (FieldManager, error) {
+	return NewFieldManagerForSubresource(models, objectConverter, objectDefaulter, gv, hub, "")
+}
+
+// NewFieldManagerForSubresource is like NewFieldManager, but scopes the
+// resulting FieldManager to a single subresource (e.g. "scale", "status").
+// Managed-fields entries it produces carry that subresource, and it only
+// considers pre-existing entries carrying the same subresource when merging,
+// so an apply to a subresource never takes or loses ownership of fields
+// recorded against a different subresource (or the main resource, for
+// subresource == ""). Returns an error for subresource != "" if this build's
+// apimachinery can't round-trip Subresource through a manager identifier,
+// rather than silently scoping nothing.
+func NewFieldManagerForSubresource(models openapiproto.Models, objectConverter runtime.ObjectConvertor, objectDefaulter runtime.ObjectDefaulter, gv schema.GroupVersion, hub schema.GroupVersion, subresource string) (FieldManager, error) {
+	return NewFieldManagerForSubresourceWithStore(models, objectConverter, objectDefaulter, gv, hub, subresource, inlineManagedFieldsStore{})
+}
+
+// NewFieldManagerForSubresourceWithStore is like NewFieldManagerForSubresource,
+// but lets the caller choose how managedFields are persisted on the object,
+// via store. Pass inlineManagedFieldsStore{} (what the other constructors
+// use) to keep today's behaviour, or NewExternalManagedFieldsStore to keep
+// only a pointer on the object and the field sets themselves out-of-band.
+func NewFieldManagerForSubresourceWithStore(models openapiproto.Models, objectConverter runtime.ObjectConvertor, objectDefaulter runtime.ObjectDefaulter, gv schema.GroupVersion, hub schema.GroupVersion, subresource string, store ManagedFieldsStore) (FieldManager, error) {
+	if subresource != "" {
+		if err := checkSubresourceIdentifierRoundTrips(subresource); err != nil {
+			return nil, err
+		}
+	}
+
 	typeConverter, err := internal.NewTypeConverter(models, false)
 	if err != nil {
 		return nil, err
@@ -75,9 +142,27 @@ func NewFieldManager(models openapiproto.Models, objectConverter runtime.ObjectC
 		updater: merge.Updater{
 			Converter: internal.NewVersionConverter(typeConverter, objectConverter, hub),
 		},
+		subresource:        subresource,
+		managedFieldsStore: store,
 	}, nil
 }
 
+// NewScaleFieldManager creates a FieldManager for the /scale subresource of
+// parentGVK (e.g. the apps/v1 Deployment that owns a given /scale). Beyond
+// behaving like a FieldManager scoped to the "scale" subresource, it
+// implements ApplyToScale, which uses a ScaleHandler to translate ownership
+// of the replicas-related fields to and from parentGVK for the duration of
+// the merge.
+func NewScaleFieldManager(models openapiproto.Models, objectConverter runtime.ObjectConvertor, objectDefaulter runtime.ObjectDefaulter, hub schema.GroupVersion, parentGVK schema.GroupVersionKind) (FieldManager, error) {
+	fm, err := NewFieldManagerForSubresourceWithStore(models, objectConverter, objectDefaulter, scaleGroupVersionKind.GroupVersion(), hub, "scale", inlineManagedFieldsStore{})
+	if err != nil {
+		return nil, err
+	}
+	f := fm.(*fieldManager)
+	f.scaleParentGVK = parentGVK
+	return f, nil
+}
+
 // NewCRDFieldManager creates a new FieldManager specifically for
 // CRDs. This allows for the possibility of fields which are not defined
 // in models, as well as having no models defined at all.
@@ -98,6 +183,7 @@ func NewCRDFieldManager(models openapiproto.Models, objectConverter runtime.Obje
 		updater: merge.Updater{
 			Converter: internal.NewCRDVersionConverter(typeConverter, objectConverter, hub),
 		},
+		managedFieldsStore: inlineManagedFieldsStore{},
 	}, nil
 }
 
@@ -111,13 +197,13 @@ func (f *fieldManager) Update(liveObj, newObj runtime.Object, manager string) (r
 
 	// First try to decode the managed fields provided in the update,
 	// This is necessary to allow directly updating managed fields.
-	managed, err := internal.DecodeObjectManagedFields(newObj)
+	managed, err := f.managedFieldsStore.Decode(newObj)
 
 	// If the managed field is empty or we failed to decode it,
 	// let's try the live object. This is to prevent clients who
 	// don't understand managedFields from deleting it accidentally.
 	if err != nil || len(managed.Fields) == 0 {
-		managed, err = internal.DecodeObjectManagedFields(liveObj)
+		managed, err = f.managedFieldsStore.Decode(liveObj)
 		if err != nil {
 			return nil, fmt.Errorf("failed to decode managed fields: %v", err)
 		}
@@ -132,6 +218,12 @@ func (f *fieldManager) Update(liveObj, newObj runtime.Object, manager string) (r
 	}
 	internal.RemoveObjectManagedFields(liveObjVersioned)
 	internal.RemoveObjectManagedFields(newObjVersioned)
+	if err := f.managedFieldsStore.Strip(liveObjVersioned); err != nil {
+		return nil, fmt.Errorf("failed to strip managed fields bookkeeping from live object: %v", err)
+	}
+	if err := f.managedFieldsStore.Strip(newObjVersioned); err != nil {
+		return nil, fmt.Errorf("failed to strip managed fields bookkeeping from new object: %v", err)
+	}
 	newObjTyped, err := f.typeConverter.ObjectToTyped(newObjVersioned)
 	if err != nil {
 		// Return newObj and just by-pass fields update. This really shouldn't happen.
@@ -146,12 +238,14 @@ func (f *fieldManager) Update(liveObj, newObj runtime.Object, manager string) (r
 	}
 	apiVersion := fieldpath.APIVersion(f.groupVersion.String())
 
+	ownFields, otherFields := f.splitFieldsBySubresource(managed.Fields)
+
 	// TODO(apelisse) use the first return value when unions are implemented
-	_, managed.Fields, err = f.updater.Update(liveObjTyped, newObjTyped, apiVersion, managed.Fields, manager)
+	_, ownFields, err = f.updater.Update(liveObjTyped, newObjTyped, apiVersion, ownFields, manager)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update ManagedFields: %v", err)
 	}
-	managed.Fields = f.stripFields(managed.Fields, manager)
+	managed.Fields = mergeFieldsBySubresource(f.stripFields(ownFields, manager), otherFields)
 
 	// If the current operation took any fields from anything, it means the object changed,
 	// so update the timestamp of the managedFieldsEntry and merge with any previous updates from the same manager
@@ -172,7 +266,7 @@ func (f *fieldManager) Update(liveObj, newObj runtime.Object, manager string) (r
 		}
 	}
 
-	if err := internal.EncodeObjectManagedFields(newObj, managed); err != nil {
+	if err := f.managedFieldsStore.Encode(newObj, managed); err != nil {
 		return nil, fmt.Errorf("failed to encode managed fields: %v", err)
 	}
 
@@ -181,29 +275,194 @@ func (f *fieldManager) Update(liveObj, newObj runtime.Object, manager string) (r
 
 // Apply implements FieldManager.
 func (f *fieldManager) Apply(liveObj runtime.Object, patch []byte, fieldManager string, force bool) (runtime.Object, error) {
-	// If the object doesn't have metadata, apply isn't allowed.
-	_, err := meta.Accessor(liveObj)
+	newObjTyped, managed, _, err := f.mergeApply(liveObj, patch, fieldManager, force)
+	if err != nil {
+		return nil, err
+	}
+
+	newObj, err := f.typeConverter.TypedToObject(newObjTyped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert new typed object to object: %v", err)
+	}
+
+	newObjVersioned, err := f.toVersioned(newObj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert new object to proper version: %v", err)
+	}
+	newObjVersioned, err = f.attributeDefaulting(newObjVersioned, &managed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attribute defaulted fields: %v", err)
+	}
+
+	if err := f.managedFieldsStore.Encode(newObjVersioned, managed); err != nil {
+		return nil, fmt.Errorf("failed to encode managed fields: %v", err)
+	}
+
+	newObjUnversioned, err := f.toUnversioned(newObjVersioned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert to unversioned: %v", err)
+	}
+	return newObjUnversioned, nil
+}
+
+// defaulterManager is the synthetic field manager that admission defaulting
+// is attributed to, so that fields the defaulter fills in can be told apart
+// from fields an applier set explicitly, and correctly reclaimed once
+// nothing defaults them anymore (e.g. after a CRD default is removed).
+const defaulterManager = "system:defaulter"
+
+// attributeDefaulting runs the object defaulter against obj and folds the
+// resulting diff into managed under defaulterManager: fields the defaulter
+// added or changed are recorded as owned by defaulterManager and taken away
+// from whichever manager owned them before, mirroring how Update attributes
+// a plain update to its manager.
+func (f *fieldManager) attributeDefaulting(obj runtime.Object, managed *internal.Metadata) (runtime.Object, error) {
+	preDefault := obj.DeepCopyObject()
+	f.objectDefaulter.Default(obj)
+
+	preTyped, err := f.typeConverter.ObjectToTyped(preDefault)
+	if err != nil {
+		return obj, fmt.Errorf("failed to create typed pre-default object: %v", err)
+	}
+	postTyped, err := f.typeConverter.ObjectToTyped(obj)
+	if err != nil {
+		return obj, fmt.Errorf("failed to create typed post-default object: %v", err)
+	}
+
+	comparison, err := preTyped.Compare(postTyped)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't get accessor: %v", err)
+		return obj, fmt.Errorf("failed to compare pre- and post-default object: %v", err)
+	}
+	defaulted := comparison.Added.Union(comparison.Modified)
+	if defaulted.Empty() {
+		return obj, nil
 	}
 
-	managed, err := internal.DecodeObjectManagedFields(liveObj)
+	manager, err := f.buildManagerInfo(defaulterManager, metav1.ManagedFieldsOperationUpdate)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode managed fields: %v", err)
+		return obj, fmt.Errorf("failed to build manager identifier: %v", err)
 	}
+
+	// Only take defaulted fields away from managers scoped to the same
+	// subresource as this defaulting pass: managed.Fields at this point is
+	// the recombined own+other map, and other belongs to a different
+	// subresource (e.g. /scale, /status) that this apply/update must never
+	// touch.
+	own, other := f.splitFieldsBySubresource(managed.Fields)
+	own = attributeDefaultedOwnership(own, manager, defaulted, fieldpath.APIVersion(f.groupVersion.String()))
+	managed.Fields = mergeFieldsBySubresource(own, other)
+	managed.Times[manager] = &metav1.Time{Time: time.Now().UTC()}
+
+	return obj, nil
+}
+
+// attributeDefaultedOwnership takes defaulted away from every other manager
+// in fields and gives it to manager, unioned with whatever manager already
+// owned. It never looks outside fields, so callers are responsible for
+// scoping fields to whatever subresource this defaulting pass applies to.
+func attributeDefaultedOwnership(fields fieldpath.ManagedFields, manager string, defaulted *fieldpath.Set, apiVersion fieldpath.APIVersion) fieldpath.ManagedFields {
+	for otherManager, vs := range fields {
+		if otherManager == manager {
+			continue
+		}
+		if rest := vs.Set().Difference(defaulted); !rest.Empty() {
+			fields[otherManager] = fieldpath.NewVersionedSet(rest, vs.APIVersion(), vs.Applied())
+		} else {
+			delete(fields, otherManager)
+		}
+	}
+
+	if previous, ok := fields[manager]; ok {
+		defaulted = defaulted.Union(previous.Set())
+	}
+	fields[manager] = fieldpath.NewVersionedSet(defaulted, apiVersion, false)
+	return fields
+}
+
+// ApplyDryRun implements FieldManager. It performs the same merge as Apply,
+// including admission defaulting and its effect on ownership, but stops
+// short of encoding the result back into the live object: it returns the
+// object as it would look after the apply, plus a diff of the ownership
+// changes the apply would cause.
+func (f *fieldManager) ApplyDryRun(liveObj runtime.Object, patch []byte, fieldManager string, force bool) (runtime.Object, ManagedFieldsDiff, error) {
+	newObjTyped, managed, before, err := f.mergeApply(liveObj, patch, fieldManager, force)
+	if err != nil {
+		return nil, ManagedFieldsDiff{}, err
+	}
+
+	newObj, err := f.typeConverter.TypedToObject(newObjTyped)
+	if err != nil {
+		return nil, ManagedFieldsDiff{}, fmt.Errorf("failed to convert new typed object to object: %v", err)
+	}
+
+	newObjVersioned, err := f.toVersioned(newObj)
+	if err != nil {
+		return nil, ManagedFieldsDiff{}, fmt.Errorf("failed to convert new object to proper version: %v", err)
+	}
+	newObjVersioned, err = f.attributeDefaulting(newObjVersioned, &managed)
+	if err != nil {
+		return nil, ManagedFieldsDiff{}, fmt.Errorf("failed to attribute defaulted fields: %v", err)
+	}
+
+	newObjUnversioned, err := f.toUnversioned(newObjVersioned)
+	if err != nil {
+		return nil, ManagedFieldsDiff{}, fmt.Errorf("failed to convert to unversioned: %v", err)
+	}
+
+	return newObjUnversioned, diffManagedFields(before, managed.Fields), nil
+}
+
+// diffManagedFields computes, per manager, which fields were gained or lost
+// going from before to after.
+func diffManagedFields(before, after fieldpath.ManagedFields) ManagedFieldsDiff {
+	diff := ManagedFieldsDiff{
+		Added:   map[string]*fieldpath.Set{},
+		Removed: map[string]*fieldpath.Set{},
+	}
+	for owner, beforeSet := range before {
+		afterSet, stillOwns := after[owner]
+		if !stillOwns {
+			diff.Removed[owner] = beforeSet.Set()
+			continue
+		}
+		if added := afterSet.Set().Difference(beforeSet.Set()); !added.Empty() {
+			diff.Added[owner] = added
+		}
+		if removed := beforeSet.Set().Difference(afterSet.Set()); !removed.Empty() {
+			diff.Removed[owner] = removed
+		}
+	}
+	for owner, afterSet := range after {
+		if _, existedBefore := before[owner]; !existedBefore {
+			diff.Added[owner] = afterSet.Set()
+		}
+	}
+	return diff
+}
+
+// decodeApplyInputs validates patch against liveObj's version and converts
+// both to typed values, ready to hand to a merge.Updater. It's the part of
+// applying that every FieldManager apply flow needs, regardless of what it
+// does with managed fields around the merge itself.
+func (f *fieldManager) decodeApplyInputs(liveObj runtime.Object, patch []byte) (liveObjTyped, patchObjTyped *typed.TypedValue, err error) {
+	// If the object doesn't have metadata, apply isn't allowed.
+	if _, err := meta.Accessor(liveObj); err != nil {
+		return nil, nil, fmt.Errorf("couldn't get accessor: %v", err)
+	}
+
 	// Check that the patch object has the same version as the live object
 	patchObj := &unstructured.Unstructured{Object: map[string]interface{}{}}
 
 	if err := yaml.Unmarshal(patch, &patchObj.Object); err != nil {
-		return nil, errors.NewBadRequest(fmt.Sprintf("error decoding YAML: %v", err))
+		return nil, nil, errors.NewBadRequest(fmt.Sprintf("error decoding YAML: %v", err))
 	}
 
 	if patchObj.GetManagedFields() != nil {
-		return nil, errors.NewBadRequest(fmt.Sprintf("metadata.managedFields must be nil"))
+		return nil, nil, errors.NewBadRequest(fmt.Sprintf("metadata.managedFields must be nil"))
 	}
 
 	if patchObj.GetAPIVersion() != f.groupVersion.String() {
-		return nil,
+		return nil, nil,
 			errors.NewBadRequest(
 				fmt.Sprintf("Incorrect version specified in apply patch. "+
 					"Specified patch version: %s, expected: %s",
@@ -212,56 +471,145 @@ func (f *fieldManager) Apply(liveObj runtime.Object, patch []byte, fieldManager
 
 	liveObjVersioned, err := f.toVersioned(liveObj)
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert live object to proper version: %v", err)
+		return nil, nil, fmt.Errorf("failed to convert live object to proper version: %v", err)
 	}
 	internal.RemoveObjectManagedFields(liveObjVersioned)
+	if err := f.managedFieldsStore.Strip(liveObjVersioned); err != nil {
+		return nil, nil, fmt.Errorf("failed to strip managed fields bookkeeping from live object: %v", err)
+	}
 
-	patchObjTyped, err := f.typeConverter.ObjectToTyped(patchObj)
+	patchObjTyped, err = f.typeConverter.ObjectToTyped(patchObj)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create typed patch object: %v", err)
+		return nil, nil, fmt.Errorf("failed to create typed patch object: %v", err)
 	}
-	liveObjTyped, err := f.typeConverter.ObjectToTyped(liveObjVersioned)
+	liveObjTyped, err = f.typeConverter.ObjectToTyped(liveObjVersioned)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create typed live object: %v", err)
+	}
+	return liveObjTyped, patchObjTyped, nil
+}
+
+// mergeApply runs the common decode/convert/merge steps shared by Apply and
+// ApplyDryRun. It returns the merged typed object, the managedFields that
+// would result, and the managedFields as they were prior to the merge (for
+// callers that need to diff the two), without deciding what to do with any
+// of them.
+func (f *fieldManager) mergeApply(liveObj runtime.Object, patch []byte, fieldManager string, force bool) (*typed.TypedValue, internal.Metadata, fieldpath.ManagedFields, error) {
+	managed, err := f.managedFieldsStore.Decode(liveObj)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create typed live object: %v", err)
+		return nil, internal.Metadata{}, nil, fmt.Errorf("failed to decode managed fields: %v", err)
+	}
+
+	liveObjTyped, patchObjTyped, err := f.decodeApplyInputs(liveObj, patch)
+	if err != nil {
+		return nil, internal.Metadata{}, nil, err
 	}
 	manager, err := f.buildManagerInfo(fieldManager, metav1.ManagedFieldsOperationApply)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build manager identifier: %v", err)
+		return nil, internal.Metadata{}, nil, fmt.Errorf("failed to build manager identifier: %v", err)
 	}
 
+	before := managed.Fields
+
+	ownFields, otherFields := f.splitFieldsBySubresource(managed.Fields)
+
 	apiVersion := fieldpath.APIVersion(f.groupVersion.String())
-	newObjTyped, managedFields, err := f.updater.Apply(liveObjTyped, patchObjTyped, apiVersion, managed.Fields, manager, force)
+	newObjTyped, ownFields, err := f.updater.Apply(liveObjTyped, patchObjTyped, apiVersion, ownFields, manager, force)
 	if err != nil {
 		if conflicts, ok := err.(merge.Conflicts); ok {
-			return nil, internal.NewConflictError(conflicts)
+			return nil, internal.Metadata{}, nil, internal.NewConflictError(conflicts)
 		}
-		return nil, err
+		return nil, internal.Metadata{}, nil, err
 	}
-	managed.Fields = f.stripFields(managedFields, manager)
+	managed.Fields = mergeFieldsBySubresource(f.stripFields(ownFields, manager), otherFields)
 
 	// Update the time in the managedFieldsEntry for this operation
 	managed.Times[manager] = &metav1.Time{Time: time.Now().UTC()}
 
-	newObj, err := f.typeConverter.TypedToObject(newObjTyped)
+	return newObjTyped, managed, before, nil
+}
+
+// ApplyToScale implements FieldManager. parentManagedFields is expected to
+// carry the full managedFields currently recorded on the resource that owns
+// this /scale (mixing entries for the main resource, /scale and any other
+// subresource); the returned internal.Metadata is in the same shape, ready
+// to be written back onto it. Like Apply, it runs admission defaulting on
+// the merged object and attributes whatever it fills in to defaulterManager.
+func (f *fieldManager) ApplyToScale(liveObj runtime.Object, patch []byte, fieldManager string, force bool, parentManagedFields internal.Metadata) (runtime.Object, internal.Metadata, error) {
+	if f.scaleParentGVK == (schema.GroupVersionKind{}) {
+		return nil, internal.Metadata{}, fmt.Errorf("ApplyToScale requires a FieldManager created with NewScaleFieldManager")
+	}
+
+	scaleOwnFields, otherFields := f.splitFieldsBySubresource(parentManagedFields.Fields)
+	mainResourceFields, unrelatedFields := splitMainResourceFields(otherFields, f.scaleParentGVK.GroupVersion())
+
+	scaleHandler, ok := NewScaleHandler(mainResourceFields, f.scaleParentGVK)
+	if !ok {
+		return nil, internal.Metadata{}, fmt.Errorf("%v does not expose a supported /scale subresource", f.scaleParentGVK)
+	}
+	translatedFields, remainingMainFields := scaleHandler.ToScale()
+	mergeInput := mergeFieldsBySubresource(scaleOwnFields, translatedFields)
+
+	liveObjTyped, patchObjTyped, err := f.decodeApplyInputs(liveObj, patch)
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert new typed object to object: %v", err)
+		return nil, internal.Metadata{}, err
+	}
+	manager, err := f.buildManagerInfo(fieldManager, metav1.ManagedFieldsOperationApply)
+	if err != nil {
+		return nil, internal.Metadata{}, fmt.Errorf("failed to build manager identifier: %v", err)
 	}
 
-	if err := internal.EncodeObjectManagedFields(newObj, managed); err != nil {
-		return nil, fmt.Errorf("failed to encode managed fields: %v", err)
+	apiVersion := fieldpath.APIVersion(f.groupVersion.String())
+	newObjTyped, mergedFields, err := f.updater.Apply(liveObjTyped, patchObjTyped, apiVersion, mergeInput, manager, force)
+	if err != nil {
+		if conflicts, ok := err.(merge.Conflicts); ok {
+			return nil, internal.Metadata{}, internal.NewConflictError(conflicts)
+		}
+		return nil, internal.Metadata{}, err
+	}
+	mergedFields = f.stripFields(mergedFields, manager)
+
+	translatedBack, scaleOwnFields := splitByKeys(mergedFields, translatedFields)
+	parentFields := scaleHandler.FromScale(translatedBack, remainingMainFields)
+	parentFields = mergeFieldsBySubresource(mergeFieldsBySubresource(parentFields, scaleOwnFields), unrelatedFields)
+
+	// Update the time in the managedFieldsEntry for this operation, the same
+	// way every other mutation path (Update, mergeApply, attributeDefaulting)
+	// stamps the manager it just wrote.
+	times := map[string]*metav1.Time{}
+	for m, t := range parentManagedFields.Times {
+		times[m] = t
+	}
+	if _, ok := parentFields[manager]; ok {
+		times[manager] = &metav1.Time{Time: time.Now().UTC()}
 	}
 
+	newObj, err := f.typeConverter.TypedToObject(newObjTyped)
+	if err != nil {
+		return nil, internal.Metadata{}, fmt.Errorf("failed to convert new typed object to object: %v", err)
+	}
 	newObjVersioned, err := f.toVersioned(newObj)
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert new object to proper version: %v", err)
+		return nil, internal.Metadata{}, fmt.Errorf("failed to convert new object to proper version: %v", err)
+	}
+
+	// Default the merged Scale the same way Apply defaults the merged main
+	// resource: attributeDefaulting splits parentFields by f.subresource
+	// ("scale") before attributing anything, so defaulting here can only
+	// ever take fields away from the /scale-scoped managers also merged
+	// above, never from the main-resource or unrelated-subresource entries
+	// carried through untouched.
+	result := internal.Metadata{Fields: parentFields, Times: times}
+	newObjVersioned, err = f.attributeDefaulting(newObjVersioned, &result)
+	if err != nil {
+		return nil, internal.Metadata{}, fmt.Errorf("failed to attribute defaulted fields: %v", err)
 	}
-	f.objectDefaulter.Default(newObjVersioned)
 
 	newObjUnversioned, err := f.toUnversioned(newObjVersioned)
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert to unversioned: %v", err)
+		return nil, internal.Metadata{}, fmt.Errorf("failed to convert to unversioned: %v", err)
 	}
-	return newObjUnversioned, nil
+	return newObjUnversioned, result, nil
 }
 
 func (f *fieldManager) toVersioned(obj runtime.Object) (runtime.Object, error) {
@@ -274,9 +622,10 @@ func (f *fieldManager) toUnversioned(obj runtime.Object) (runtime.Object, error)
 
 func (f *fieldManager) buildManagerInfo(prefix string, operation metav1.ManagedFieldsOperationType) (string, error) {
 	managerInfo := metav1.ManagedFieldsEntry{
-		Manager:    prefix,
-		Operation:  operation,
-		APIVersion: f.groupVersion.String(),
+		Manager:     prefix,
+		Operation:   operation,
+		APIVersion:  f.groupVersion.String(),
+		Subresource: f.subresource,
 	}
 	if managerInfo.Manager == "" {
 		managerInfo.Manager = "unknown"
@@ -284,6 +633,80 @@ func (f *fieldManager) buildManagerInfo(prefix string, operation metav1.ManagedF
 	return internal.BuildManagerIdentifier(&managerInfo)
 }
 
+// checkSubresourceIdentifierRoundTrips guards against the failure mode where
+// subresource scoping silently becomes a no-op: splitFieldsBySubresource
+// treats any manager identifier it can't decode as belonging to the main
+// resource, which is the right fallback for a legacy identifier predating
+// subresource scoping, but the wrong one if this build's
+// metav1.ManagedFieldsEntry/internal.BuildManagerIdentifier simply don't
+// carry Subresource at all - every entry would decode "successfully" with
+// Subresource == "", and a /scale apply would silently take and lose
+// ownership of main-resource fields instead of being scoped away from them.
+// Build-then-decode a throwaway identifier up front and fail loudly here,
+// at construction time, rather than leave that to be discovered later as a
+// subtle ownership bug.
+func checkSubresourceIdentifierRoundTrips(subresource string) error {
+	probe := metav1.ManagedFieldsEntry{
+		Manager:     "unknown",
+		Operation:   metav1.ManagedFieldsOperationApply,
+		Subresource: subresource,
+	}
+	id, err := internal.BuildManagerIdentifier(&probe)
+	if err != nil {
+		return fmt.Errorf("failed to build a manager identifier carrying subresource %q: %v", subresource, err)
+	}
+	decoded, err := internal.DecodeManagerIdentifier(id)
+	if err != nil {
+		return fmt.Errorf("failed to decode a manager identifier carrying subresource %q: %v", subresource, err)
+	}
+	if decoded.Subresource != subresource {
+		return fmt.Errorf("manager identifiers in this apimachinery build don't round-trip Subresource (built %q, decoded %q); subresource-scoped field management requires metav1.ManagedFieldsEntry.Subresource support", subresource, decoded.Subresource)
+	}
+	return nil
+}
+
+// splitFieldsBySubresource splits managed into the entries recorded against
+// f.subresource (own) and everything else (other). Only own should ever be
+// touched by a merge scoped to this subresource; other must be carried
+// through untouched so that, for example, an apply to /scale can't take or
+// relinquish ownership of fields recorded against the main resource.
+//
+// A manager identifier that predates subresource scoping (or was written by
+// a skewed-version apiserver) won't decode; such entries are treated as
+// belonging to the main resource rather than failing the whole Update/Apply,
+// so rolling out subresource scoping never breaks Updates/Applies against
+// objects that already have managedFields.
+func (f *fieldManager) splitFieldsBySubresource(managed fieldpath.ManagedFields) (own, other fieldpath.ManagedFields) {
+	own = fieldpath.ManagedFields{}
+	other = fieldpath.ManagedFields{}
+	for manager, vs := range managed {
+		subresource := ""
+		if entry, err := internal.DecodeManagerIdentifier(manager); err == nil {
+			subresource = entry.Subresource
+		}
+		if subresource == f.subresource {
+			own[manager] = vs
+		} else {
+			other[manager] = vs
+		}
+	}
+	return own, other
+}
+
+// mergeFieldsBySubresource recombines own (the result of a merge scoped to
+// f.subresource) with other (entries for every other subresource, left
+// untouched).
+func mergeFieldsBySubresource(own, other fieldpath.ManagedFields) fieldpath.ManagedFields {
+	merged := fieldpath.ManagedFields{}
+	for manager, vs := range other {
+		merged[manager] = vs
+	}
+	for manager, vs := range own {
+		merged[manager] = vs
+	}
+	return merged
+}
+
 // stripSet is the list of fields that should never be part of a mangedFields.
 var stripSet = fieldpath.NewSet(
 	fieldpath.MakePathOrDie("apiVersion"),
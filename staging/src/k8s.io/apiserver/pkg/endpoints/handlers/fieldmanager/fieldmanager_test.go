@@ -0,0 +1,201 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fieldmanager
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/endpoints/handlers/fieldmanager/internal"
+	"sigs.k8s.io/structured-merge-diff/fieldpath"
+)
+
+// identityObjectConvertor is a runtime.ObjectConvertor fake for tests that
+// don't exercise actual version conversion: every object in these tests is
+// already at the only version involved.
+type identityObjectConvertor struct{}
+
+func (identityObjectConvertor) Convert(in, out, context interface{}) error {
+	return fmt.Errorf("Convert is not implemented by this test fake")
+}
+
+func (identityObjectConvertor) ConvertToVersion(in runtime.Object, target runtime.GroupVersioner) (runtime.Object, error) {
+	return in.DeepCopyObject(), nil
+}
+
+func (identityObjectConvertor) ConvertFieldLabel(gvk schema.GroupVersionKind, label, value string) (string, string, error) {
+	return label, value, nil
+}
+
+// pausedDefaulter is a runtime.ObjectDefaulter fake that defaults
+// spec.paused to false, standing in for a real admission defaulter so tests
+// can observe attributeDefaulting's effect on managedFields.
+type pausedDefaulter struct{}
+
+func (pausedDefaulter) Default(in runtime.Object) {
+	u, ok := in.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	if _, found, _ := unstructured.NestedBool(u.Object, "spec", "paused"); !found {
+		unstructured.SetNestedField(u.Object, false, "spec", "paused")
+	}
+}
+
+// TestSplitFieldsBySubresourceLegacyManager verifies that a manager
+// identifier predating subresource scoping (i.e. one that doesn't decode)
+// is treated as belonging to the main resource instead of failing the
+// split, so existing objects don't break when subresource scoping rolls
+// out.
+func TestSplitFieldsBySubresourceLegacyManager(t *testing.T) {
+	f := &fieldManager{subresource: ""}
+	set := fieldpath.NewVersionedSet(fieldpath.NewSet(fieldpath.MakePathOrDie("spec", "replicas")), "apps/v1", false)
+	managed := fieldpath.ManagedFields{
+		"not-a-valid-manager-identifier": set,
+	}
+
+	own, other := f.splitFieldsBySubresource(managed)
+	if _, ok := own["not-a-valid-manager-identifier"]; !ok {
+		t.Fatalf("expected undecodable legacy manager to be treated as own (main resource), got own=%v other=%v", own, other)
+	}
+	if len(other) != 0 {
+		t.Fatalf("expected other to be empty, got %v", other)
+	}
+}
+
+// TestCheckSubresourceIdentifierRoundTrips verifies the guard
+// NewFieldManagerForSubresourceWithStore runs before trusting subresource
+// scoping: a manager identifier built with a given Subresource must decode
+// back to that same Subresource, or subresource scoping would silently
+// degrade to treating every entry as belonging to the main resource.
+func TestCheckSubresourceIdentifierRoundTrips(t *testing.T) {
+	if err := checkSubresourceIdentifierRoundTrips("scale"); err != nil {
+		t.Fatalf("expected \"scale\" to round-trip through this build's manager identifier encoding, got %v", err)
+	}
+}
+
+// TestAttributeDefaultedOwnershipTakesDefaultedFieldsFromOtherManagers
+// verifies that attributeDefaultedOwnership takes a defaulted field away from
+// the manager that owned it, dropping that manager once it owns nothing else,
+// and records the field as owned by the defaulter manager instead.
+func TestAttributeDefaultedOwnershipTakesDefaultedFieldsFromOtherManagers(t *testing.T) {
+	replicas := fieldpath.NewSet(fieldpath.MakePathOrDie("spec", "replicas"))
+	own := fieldpath.ManagedFields{
+		"controller-manager": fieldpath.NewVersionedSet(replicas, "apps/v1", false),
+	}
+
+	result := attributeDefaultedOwnership(own, "system:defaulter", replicas, "apps/v1")
+
+	if _, ok := result["controller-manager"]; ok {
+		t.Fatalf("expected controller-manager to lose all ownership of the defaulted field, got %v", result)
+	}
+	vs, ok := result["system:defaulter"]
+	if !ok || !vs.Set().Difference(replicas).Empty() || !replicas.Difference(vs.Set()).Empty() {
+		t.Fatalf("expected system:defaulter to own %v, got %v", replicas, result)
+	}
+}
+
+// TestDiffManagedFieldsReflectsDefaulting verifies that diffManagedFields,
+// which ApplyDryRun uses to build its preview, surfaces a defaulting-driven
+// ownership transfer the same way it would surface any other ownership
+// change, so a dry run doesn't hide the effect of attributeDefaultedOwnership
+// running as part of the same apply.
+func TestDiffManagedFieldsReflectsDefaulting(t *testing.T) {
+	image := fieldpath.NewSet(fieldpath.MakePathOrDie("spec", "template", "spec", "image"))
+	before := fieldpath.ManagedFields{
+		"applier": fieldpath.NewVersionedSet(image, "apps/v1", true),
+	}
+	after := fieldpath.ManagedFields{
+		"system:defaulter": fieldpath.NewVersionedSet(image, "apps/v1", false),
+	}
+
+	diff := diffManagedFields(before, after)
+
+	if _, ok := diff.Removed["applier"]; !ok {
+		t.Fatalf("expected applier to show up as having lost the defaulted field, got %v", diff.Removed)
+	}
+	if _, ok := diff.Added["system:defaulter"]; !ok {
+		t.Fatalf("expected system:defaulter to show up as having gained the defaulted field, got %v", diff.Added)
+	}
+}
+
+// TestApplyDryRunReflectsDefaultingWithoutMutatingLiveObject drives
+// ApplyDryRun through a real fieldManager (built via NewCRDFieldManager, so
+// no openapi models fixture is needed) to verify the behavior the diffing
+// helpers above only exercise in isolation: the live object is left alone,
+// the previewed object carries both the applied and the admission-defaulted
+// fields, and the diff attributes the defaulted field to defaulterManager.
+func TestApplyDryRunReflectsDefaultingWithoutMutatingLiveObject(t *testing.T) {
+	gv := schema.GroupVersion{Group: "apps", Version: "v1"}
+	fm, err := NewCRDFieldManager(nil, identityObjectConvertor{}, pausedDefaulter{}, gv, gv, true)
+	if err != nil {
+		t.Fatalf("failed to create field manager: %v", err)
+	}
+
+	liveObj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "my-deploy"},
+		"spec":       map[string]interface{}{"replicas": int64(3)},
+	}}
+	liveObjBefore := liveObj.DeepCopy()
+
+	patch := []byte(`{"apiVersion":"apps/v1","kind":"Deployment","spec":{"replicas":5}}`)
+
+	result, diff, err := fm.ApplyDryRun(liveObj, patch, "applier", false)
+	if err != nil {
+		t.Fatalf("ApplyDryRun failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(liveObj, liveObjBefore) {
+		t.Fatalf("ApplyDryRun must not mutate the live object, got %v, want %v", liveObj, liveObjBefore)
+	}
+
+	resultObj, ok := result.(*unstructured.Unstructured)
+	if !ok {
+		t.Fatalf("expected *unstructured.Unstructured, got %T", result)
+	}
+	if replicas, _, _ := unstructured.NestedInt64(resultObj.Object, "spec", "replicas"); replicas != 5 {
+		t.Fatalf("expected the previewed object to carry the applied spec.replicas=5, got %d", replicas)
+	}
+	if paused, found, _ := unstructured.NestedBool(resultObj.Object, "spec", "paused"); !found || paused {
+		t.Fatalf("expected the previewed object to carry the admission-defaulted spec.paused=false, got found=%v value=%v", found, paused)
+	}
+
+	applierSeen := false
+	for manager := range diff.Added {
+		if entry, err := internal.DecodeManagerIdentifier(manager); err == nil && entry.Manager == "applier" {
+			applierSeen = true
+		}
+	}
+	if !applierSeen {
+		t.Fatalf("expected applier to show up as gaining spec.replicas in the dry-run diff, got %v", diff.Added)
+	}
+	defaulterSeen := false
+	for manager := range diff.Added {
+		if entry, err := internal.DecodeManagerIdentifier(manager); err == nil && entry.Manager == defaulterManager {
+			defaulterSeen = true
+		}
+	}
+	if !defaulterSeen {
+		t.Fatalf("expected %s to show up as gaining spec.paused in the dry-run diff, got %v", defaulterManager, diff.Added)
+	}
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fieldmanager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/endpoints/handlers/fieldmanager/internal"
+	"k8s.io/klog"
+	"sigs.k8s.io/structured-merge-diff/fieldpath"
+)
+
+// managedFieldsPointerAnnotation is where an external ManagedFieldsStore
+// records the key of the out-of-band blob holding the object's
+// fieldpath.ManagedFields, in place of the inline metadata.managedFields
+// content.
+const managedFieldsPointerAnnotation = "internal.apiserver.k8s.io/managed-fields-ref"
+
+// ManagedFieldsStore persists and retrieves the managedFields recorded
+// against an object. FieldManager is parameterized over it so that callers
+// can move the (potentially large) field sets out of the object without
+// touching the merge logic itself.
+type ManagedFieldsStore interface {
+	// Decode returns the managedFields recorded for obj.
+	Decode(obj runtime.Object) (internal.Metadata, error)
+	// Encode records managed onto obj.
+	Encode(obj runtime.Object, managed internal.Metadata) error
+	// Strip removes whatever bookkeeping this store's Encode wrote onto obj
+	// beyond the inline managedFields that internal.RemoveObjectManagedFields
+	// already strips, so that bookkeeping never participates in a merge as
+	// if it were a field the object itself owns.
+	Strip(obj runtime.Object) error
+}
+
+// inlineManagedFieldsStore is the default ManagedFieldsStore: the full
+// managedFields live inline in metadata.managedFields, as they always have.
+type inlineManagedFieldsStore struct{}
+
+func (inlineManagedFieldsStore) Decode(obj runtime.Object) (internal.Metadata, error) {
+	return internal.DecodeObjectManagedFields(obj)
+}
+
+func (inlineManagedFieldsStore) Encode(obj runtime.Object, managed internal.Metadata) error {
+	return internal.EncodeObjectManagedFields(obj, managed)
+}
+
+func (inlineManagedFieldsStore) Strip(obj runtime.Object) error { return nil }
+
+// ManagedFieldsBlobStore is the out-of-band half of an external
+// ManagedFieldsStore: something that can persist and retrieve the full
+// fieldpath.ManagedFields for a given content-addressed key. Implementations
+// might write to an etcd key, a compressed annotation, or a caller-provided
+// KV store.
+type ManagedFieldsBlobStore interface {
+	Put(key string, fields fieldpath.ManagedFields) error
+	Get(key string) (fieldpath.ManagedFields, error)
+	// Delete removes the blob at key. externalManagedFieldsStore calls this
+	// for the blob an Encode just superseded, so blobs don't accumulate
+	// forever and undercut the object-size savings this store exists for.
+	Delete(key string) error
+}
+
+// NewExternalManagedFieldsStore returns a ManagedFieldsStore that keeps only
+// a content hash pointing at blobs on the object, and stores the actual
+// fieldpath.ManagedFields via blobs. Per-manager timestamps stay inline,
+// since they're small and needed to answer "who touched this last" without
+// a round trip to the blob store.
+func NewExternalManagedFieldsStore(blobs ManagedFieldsBlobStore) ManagedFieldsStore {
+	return &externalManagedFieldsStore{blobs: blobs}
+}
+
+type externalManagedFieldsStore struct {
+	blobs ManagedFieldsBlobStore
+}
+
+func (s *externalManagedFieldsStore) Decode(obj runtime.Object) (internal.Metadata, error) {
+	managed, err := internal.DecodeObjectManagedFields(obj)
+	if err != nil {
+		return internal.Metadata{}, err
+	}
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return internal.Metadata{}, fmt.Errorf("couldn't get accessor: %v", err)
+	}
+	pointer := accessor.GetAnnotations()[managedFieldsPointerAnnotation]
+	if pointer == "" {
+		return managed, nil
+	}
+
+	fields, err := s.blobs.Get(pointer)
+	if err != nil {
+		// The blob store is a side channel: it isn't guaranteed to be as
+		// durable as the object store backing managed itself (an evicted
+		// cache entry, a lagging read replica, a key that hasn't replicated
+		// yet). Losing it shouldn't brick every subsequent apply against
+		// this object, so fall back to the compacted inline entries
+		// (correct Manager/Operation/APIVersion/Time, empty field sets)
+		// rather than failing Decode outright; the next successful Encode
+		// repopulates the blob from whatever the merge computes.
+		klog.Errorf("failed to fetch managed fields blob %q, falling back to compacted inline entries: %v", pointer, err)
+		return managed, nil
+	}
+	managed.Fields = fields
+	return managed, nil
+}
+
+func (s *externalManagedFieldsStore) Encode(obj runtime.Object, managed internal.Metadata) error {
+	pointer := managedFieldsContentHash(managed.Fields)
+	if err := s.blobs.Put(pointer, managed.Fields); err != nil {
+		return fmt.Errorf("failed to store managed fields blob %q: %v", pointer, err)
+	}
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return fmt.Errorf("couldn't get accessor: %v", err)
+	}
+	annotations := accessor.GetAnnotations()
+	previousPointer := annotations[managedFieldsPointerAnnotation]
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[managedFieldsPointerAnnotation] = pointer
+	accessor.SetAnnotations(annotations)
+
+	// EncodeObjectManagedFields builds one ManagedFieldsEntry per manager in
+	// Fields, so passing an empty Fields would silently write zero entries
+	// and drop the per-manager timestamps along with everything else. Keep
+	// one empty-Set entry per manager instead: the (potentially large) field
+	// sets already went to the blob store above, but Manager/Operation/
+	// APIVersion/Subresource/Time still round-trip inline.
+	compacted := compactManagedFieldsForInlineStorage(managed.Fields)
+	if err := internal.EncodeObjectManagedFields(obj, internal.Metadata{Fields: compacted, Times: managed.Times}); err != nil {
+		return err
+	}
+
+	// Best-effort GC of the blob this Encode just superseded: a delete
+	// failure here doesn't leave obj in an inconsistent state (the new blob
+	// and pointer are already committed above), it just leaks one blob, so
+	// it's logged rather than failing the whole Encode.
+	if previousPointer != "" && previousPointer != pointer {
+		if err := s.blobs.Delete(previousPointer); err != nil {
+			klog.Errorf("failed to delete superseded managed fields blob %q: %v", previousPointer, err)
+		}
+	}
+
+	return nil
+}
+
+// Strip removes the pointer annotation Encode writes, the out-of-band
+// counterpart to internal.RemoveObjectManagedFields stripping the inline
+// metadata.managedFields: without this, a client applying metadata.
+// annotations without this key would drop the pointer and the merge itself
+// would see (and could overwrite) an annotation that isn't really part of
+// the object's content.
+func (s *externalManagedFieldsStore) Strip(obj runtime.Object) error {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return fmt.Errorf("couldn't get accessor: %v", err)
+	}
+	annotations := accessor.GetAnnotations()
+	if _, ok := annotations[managedFieldsPointerAnnotation]; !ok {
+		return nil
+	}
+	delete(annotations, managedFieldsPointerAnnotation)
+	accessor.SetAnnotations(annotations)
+	return nil
+}
+
+// compactManagedFieldsForInlineStorage replaces every manager's field set
+// with an empty one, keeping only the APIVersion and Applied it needs to
+// still produce a valid ManagedFieldsEntry.
+func compactManagedFieldsForInlineStorage(fields fieldpath.ManagedFields) fieldpath.ManagedFields {
+	compacted := fieldpath.ManagedFields{}
+	for manager, vs := range fields {
+		compacted[manager] = fieldpath.NewVersionedSet(fieldpath.NewSet(), vs.APIVersion(), vs.Applied())
+	}
+	return compacted
+}
+
+// managedFieldsContentHash derives a stable, content-addressed key for a set
+// of managedFields, so that unchanged managedFields (the common case for a
+// no-op reconcile loop) reuse the same blob key instead of writing a new one
+// on every update.
+func managedFieldsContentHash(fields fieldpath.ManagedFields) string {
+	managers := make([]string, 0, len(fields))
+	for manager := range fields {
+		managers = append(managers, manager)
+	}
+	sort.Strings(managers)
+
+	h := sha256.New()
+	for _, manager := range managers {
+		vs := fields[manager]
+		fmt.Fprintf(h, "%s\x00%s\x00%v\x00%s\x00", manager, vs.APIVersion(), vs.Applied(), vs.Set().String())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fieldmanager
+
+import (
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apiserver/pkg/endpoints/handlers/fieldmanager/internal"
+	"sigs.k8s.io/structured-merge-diff/fieldpath"
+)
+
+// erroringBlobStore is a ManagedFieldsBlobStore fake whose Get always fails,
+// standing in for a side channel that has lost or not yet replicated a blob.
+type erroringBlobStore struct{}
+
+func (erroringBlobStore) Put(key string, fields fieldpath.ManagedFields) error { return nil }
+
+func (erroringBlobStore) Get(key string) (fieldpath.ManagedFields, error) {
+	return nil, fmt.Errorf("blob %q not found", key)
+}
+
+func (erroringBlobStore) Delete(key string) error { return nil }
+
+// memoryBlobStore is an in-memory ManagedFieldsBlobStore fake, so tests can
+// observe which keys Encode wrote and GC'd.
+type memoryBlobStore struct {
+	blobs map[string]fieldpath.ManagedFields
+}
+
+func (s *memoryBlobStore) Put(key string, fields fieldpath.ManagedFields) error {
+	if s.blobs == nil {
+		s.blobs = map[string]fieldpath.ManagedFields{}
+	}
+	s.blobs[key] = fields
+	return nil
+}
+
+func (s *memoryBlobStore) Get(key string) (fieldpath.ManagedFields, error) {
+	fields, ok := s.blobs[key]
+	if !ok {
+		return nil, fmt.Errorf("blob %q not found", key)
+	}
+	return fields, nil
+}
+
+func (s *memoryBlobStore) Delete(key string) error {
+	delete(s.blobs, key)
+	return nil
+}
+
+// TestCompactManagedFieldsForInlineStorageKeepsEveryManager verifies that
+// compacting for inline storage keeps one entry per manager (so
+// EncodeObjectManagedFields still writes a ManagedFieldsEntry, and thus a
+// Time, for each of them) while dropping the (potentially large) field set
+// itself.
+func TestCompactManagedFieldsForInlineStorageKeepsEveryManager(t *testing.T) {
+	fields := fieldpath.ManagedFields{
+		"controller-manager":        fieldpath.NewVersionedSet(fieldpath.NewSet(fieldpath.MakePathOrDie("spec", "replicas")), "apps/v1", false),
+		"kubectl-client-side-apply": fieldpath.NewVersionedSet(fieldpath.NewSet(fieldpath.MakePathOrDie("spec")), "apps/v1", true),
+	}
+
+	compacted := compactManagedFieldsForInlineStorage(fields)
+
+	if len(compacted) != len(fields) {
+		t.Fatalf("expected one compacted entry per manager, got %d for %d managers", len(compacted), len(fields))
+	}
+	for manager, vs := range fields {
+		got, ok := compacted[manager]
+		if !ok {
+			t.Fatalf("expected manager %q to still have an entry after compacting", manager)
+		}
+		if !got.Set().Empty() {
+			t.Fatalf("expected manager %q's compacted set to be empty, got %v", manager, got.Set())
+		}
+		if got.APIVersion() != vs.APIVersion() || got.Applied() != vs.Applied() {
+			t.Fatalf("expected manager %q to keep its APIVersion/Applied, got %v/%v", manager, got.APIVersion(), got.Applied())
+		}
+	}
+}
+
+// TestManagedFieldsContentHashIsOrderIndependent verifies that
+// managedFieldsContentHash doesn't depend on Go's randomized map iteration
+// order, since the same content should map to the same blob key.
+func TestManagedFieldsContentHashIsOrderIndependent(t *testing.T) {
+	a := fieldpath.ManagedFields{
+		"applier-a": fieldpath.NewVersionedSet(fieldpath.NewSet(fieldpath.MakePathOrDie("spec")), "apps/v1", true),
+		"applier-b": fieldpath.NewVersionedSet(fieldpath.NewSet(fieldpath.MakePathOrDie("status")), "apps/v1", false),
+	}
+	b := fieldpath.ManagedFields{
+		"applier-b": a["applier-b"],
+		"applier-a": a["applier-a"],
+	}
+
+	if managedFieldsContentHash(a) != managedFieldsContentHash(b) {
+		t.Fatalf("expected content hash to be independent of map construction order")
+	}
+}
+
+// TestExternalManagedFieldsStoreDecodeFallsBackOnMissingBlob verifies that a
+// failed blob lookup degrades to the compacted inline entries instead of
+// failing Decode outright, so a lost or not-yet-replicated blob doesn't
+// permanently brick every subsequent apply against the object.
+func TestExternalManagedFieldsStoreDecodeFallsBackOnMissingBlob(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name": "my-deploy",
+			"annotations": map[string]interface{}{
+				managedFieldsPointerAnnotation: "deadbeef",
+			},
+		},
+	}}
+
+	store := NewExternalManagedFieldsStore(erroringBlobStore{})
+
+	managed, err := store.Decode(obj)
+	if err != nil {
+		t.Fatalf("expected Decode to fall back instead of failing, got err=%v", err)
+	}
+	if len(managed.Fields) != 0 {
+		t.Fatalf("expected no field sets to be recovered from the missing blob, got %v", managed.Fields)
+	}
+}
+
+// TestExternalManagedFieldsStoreEncodeGarbageCollectsSupersededBlob verifies
+// that a second Encode deletes the blob the first one wrote once it's no
+// longer referenced, so blobs don't accumulate forever and undercut the
+// object-size savings this store exists for.
+func TestExternalManagedFieldsStoreEncodeGarbageCollectsSupersededBlob(t *testing.T) {
+	blobs := &memoryBlobStore{}
+	store := NewExternalManagedFieldsStore(blobs)
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "my-deploy"},
+	}}
+
+	first := fieldpath.ManagedFields{
+		"applier": fieldpath.NewVersionedSet(fieldpath.NewSet(fieldpath.MakePathOrDie("spec")), "apps/v1", true),
+	}
+	if err := store.Encode(obj, internal.Metadata{Fields: first, Times: map[string]*metav1.Time{}}); err != nil {
+		t.Fatalf("first Encode failed: %v", err)
+	}
+	if len(blobs.blobs) != 1 {
+		t.Fatalf("expected exactly one blob after the first Encode, got %v", blobs.blobs)
+	}
+
+	second := fieldpath.ManagedFields{
+		"applier": fieldpath.NewVersionedSet(fieldpath.NewSet(fieldpath.MakePathOrDie("status")), "apps/v1", true),
+	}
+	if err := store.Encode(obj, internal.Metadata{Fields: second, Times: map[string]*metav1.Time{}}); err != nil {
+		t.Fatalf("second Encode failed: %v", err)
+	}
+	if len(blobs.blobs) != 1 {
+		t.Fatalf("expected the first blob to be garbage collected, got %v", blobs.blobs)
+	}
+}
+
+// TestExternalManagedFieldsStoreStripRemovesPointerAnnotation verifies that
+// Strip removes the out-of-band pointer annotation Encode writes, so it
+// can't survive RemoveObjectManagedFields and end up participating in a
+// merge as if it were real object content.
+func TestExternalManagedFieldsStoreStripRemovesPointerAnnotation(t *testing.T) {
+	store := NewExternalManagedFieldsStore(&memoryBlobStore{})
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "my-deploy"},
+	}}
+
+	fields := fieldpath.ManagedFields{
+		"applier": fieldpath.NewVersionedSet(fieldpath.NewSet(fieldpath.MakePathOrDie("spec")), "apps/v1", true),
+	}
+	if err := store.Encode(obj, internal.Metadata{Fields: fields, Times: map[string]*metav1.Time{}}); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if _, ok := obj.GetAnnotations()[managedFieldsPointerAnnotation]; !ok {
+		t.Fatalf("expected Encode to have set the pointer annotation")
+	}
+
+	if err := store.Strip(obj); err != nil {
+		t.Fatalf("Strip failed: %v", err)
+	}
+	if _, ok := obj.GetAnnotations()[managedFieldsPointerAnnotation]; ok {
+		t.Fatalf("expected Strip to remove the pointer annotation, got %v", obj.GetAnnotations())
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fieldmanager
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/endpoints/handlers/fieldmanager/internal"
+	"sigs.k8s.io/structured-merge-diff/fieldpath"
+)
+
+// scaleGroupVersionKind is the GroupVersionKind that a /scale subresource is
+// represented as on the wire, regardless of the parent resource's own
+// group/version.
+var scaleGroupVersionKind = schema.GroupVersionKind{Group: "autoscaling", Version: "v1", Kind: "Scale"}
+
+// scaleFieldPaths are the fields on a workload resource that have a
+// counterpart on the autoscaling/v1 Scale object. Ownership of these fields
+// is what needs to move between the parent resource and /scale.
+var scaleFieldPaths = fieldpath.NewSet(
+	fieldpath.MakePathOrDie("spec", "replicas"),
+	fieldpath.MakePathOrDie("status", "replicas"),
+	fieldpath.MakePathOrDie("status", "selector"),
+)
+
+// scaleableGroupVersionKinds is the registry of parent resource kinds that
+// expose a /scale subresource backed by scaleFieldPaths.
+var scaleableGroupVersionKinds = map[schema.GroupVersionKind]bool{
+	{Group: "apps", Version: "v1", Kind: "Deployment"}:        true,
+	{Group: "apps", Version: "v1", Kind: "ReplicaSet"}:        true,
+	{Group: "apps", Version: "v1", Kind: "StatefulSet"}:       true,
+	{Group: "", Version: "v1", Kind: "ReplicationController"}: true,
+}
+
+// ScaleHandler translates managed-fields ownership of the replicas-related
+// fields between a workload resource and its /scale subresource, so that an
+// apply against /scale participates in the same ownership tracking as an
+// apply against the parent resource.
+type ScaleHandler struct {
+	parentManagedFields fieldpath.ManagedFields
+	parentGVK           schema.GroupVersionKind
+}
+
+// NewScaleHandler returns a ScaleHandler seeded with the parent resource's
+// current managedFields. It returns false if parentGVK does not expose a
+// supported /scale subresource; fieldManager.ApplyToScale returns an error
+// in that case.
+func NewScaleHandler(parentManagedFields fieldpath.ManagedFields, parentGVK schema.GroupVersionKind) (*ScaleHandler, bool) {
+	if !scaleableGroupVersionKinds[parentGVK] {
+		return nil, false
+	}
+	return &ScaleHandler{parentManagedFields: parentManagedFields, parentGVK: parentGVK}, true
+}
+
+// ToScale splits the parent's managedFields into the subset that concerns
+// the replicas-related fields, rewritten under the Scale GVK so that it can
+// be merged against a /scale apply, and the remainder, left as-is so it can
+// be written back onto the parent resource untouched.
+func (s *ScaleHandler) ToScale() (scaleFields, otherFields fieldpath.ManagedFields) {
+	scaleFields = fieldpath.ManagedFields{}
+	otherFields = fieldpath.ManagedFields{}
+	scaleAPIVersion := fieldpath.APIVersion(scaleGroupVersionKind.GroupVersion().String())
+
+	for manager, vs := range s.parentManagedFields {
+		replicaSet := vs.Set().Intersection(scaleFieldPaths)
+		if !replicaSet.Empty() {
+			scaleFields[manager] = fieldpath.NewVersionedSet(replicaSet, scaleAPIVersion, vs.Applied())
+		}
+		if rest := vs.Set().Difference(scaleFieldPaths); !rest.Empty() {
+			otherFields[manager] = fieldpath.NewVersionedSet(rest, vs.APIVersion(), vs.Applied())
+		}
+	}
+	return scaleFields, otherFields
+}
+
+// FromScale rewrites the managedFields that resulted from merging a /scale
+// apply (seeded from ToScale's scaleFields) back under the parent GVK, and
+// unions them with otherFields, so the result is ready to be written back
+// onto the parent resource's managedFields.
+func (s *ScaleHandler) FromScale(mergedScaleFields, otherFields fieldpath.ManagedFields) fieldpath.ManagedFields {
+	parentAPIVersion := fieldpath.APIVersion(s.parentGVK.GroupVersion().String())
+
+	merged := fieldpath.ManagedFields{}
+	for manager, vs := range otherFields {
+		merged[manager] = vs
+	}
+	for manager, vs := range mergedScaleFields {
+		translated := fieldpath.NewVersionedSet(vs.Set(), parentAPIVersion, vs.Applied())
+		if existing, ok := merged[manager]; ok {
+			merged[manager] = fieldpath.NewVersionedSet(existing.Set().Union(translated.Set()), existing.APIVersion(), existing.Applied())
+			continue
+		}
+		merged[manager] = translated
+	}
+	return merged
+}
+
+// splitMainResourceFields splits fields into the entries recorded under gv
+// against the main resource (no subresource) and everything else. GroupVersion
+// alone isn't enough to identify main-resource ownership: another subresource
+// of the same parent (e.g. /status) virtually always shares the parent's own
+// GroupVersion, and its entries must stay out of mainResourceFields or
+// ApplyToScale would feed them into the /scale merge and let an apply there
+// steal ownership recorded against that unrelated subresource. A manager
+// identifier that doesn't decode is treated as scoped to the main resource,
+// matching how fieldManager.splitFieldsBySubresource treats legacy manager
+// identifiers that predate subresource scoping.
+func splitMainResourceFields(fields fieldpath.ManagedFields, gv schema.GroupVersion) (matching, other fieldpath.ManagedFields) {
+	matching = fieldpath.ManagedFields{}
+	other = fieldpath.ManagedFields{}
+	apiVersion := fieldpath.APIVersion(gv.String())
+	for manager, vs := range fields {
+		subresource := ""
+		if entry, err := internal.DecodeManagerIdentifier(manager); err == nil {
+			subresource = entry.Subresource
+		}
+		if vs.APIVersion() == apiVersion && subresource == "" {
+			matching[manager] = vs
+		} else {
+			other[manager] = vs
+		}
+	}
+	return matching, other
+}
+
+// splitByKeys splits fields into the entries whose manager also appears in
+// keys and everything else.
+func splitByKeys(fields, keys fieldpath.ManagedFields) (matching, other fieldpath.ManagedFields) {
+	matching = fieldpath.ManagedFields{}
+	other = fieldpath.ManagedFields{}
+	for manager, vs := range fields {
+		if _, ok := keys[manager]; ok {
+			matching[manager] = vs
+		} else {
+			other[manager] = vs
+		}
+	}
+	return matching, other
+}
@@ -0,0 +1,362 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fieldmanager
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/endpoints/handlers/fieldmanager/internal"
+	"sigs.k8s.io/structured-merge-diff/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/merge"
+)
+
+var deploymentGVK = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+
+// TestScaleHandlerPreservesReplicaOwnershipAcrossGVKs verifies the
+// ToScale/FromScale round trip a /scale apply flow relies on: a controller's
+// ownership of spec.replicas, recorded under the parent's own GVK, survives
+// being merged against an HPA's /scale apply and comes back keyed under the
+// parent GVK again, instead of being silently dropped by the GVK mismatch.
+func TestScaleHandlerPreservesReplicaOwnershipAcrossGVKs(t *testing.T) {
+	replicas := fieldpath.NewSet(fieldpath.MakePathOrDie("spec", "replicas"))
+	image := fieldpath.NewSet(fieldpath.MakePathOrDie("spec", "template", "spec", "image"))
+
+	parentManagedFields := fieldpath.ManagedFields{
+		"deployment-controller": fieldpath.NewVersionedSet(replicas.Union(image), "apps/v1", false),
+	}
+
+	handler, ok := NewScaleHandler(parentManagedFields, deploymentGVK)
+	if !ok {
+		t.Fatalf("expected %v to expose a supported /scale subresource", deploymentGVK)
+	}
+
+	scaleFields, otherFields := handler.ToScale()
+	vs, ok := scaleFields["deployment-controller"]
+	if !ok || vs.APIVersion() != "autoscaling/v1" || !vs.Set().Difference(replicas).Empty() || !replicas.Difference(vs.Set()).Empty() {
+		t.Fatalf("expected deployment-controller's replica ownership to be translated to autoscaling/v1, got %v", scaleFields)
+	}
+	if rest, ok := otherFields["deployment-controller"]; !ok || !rest.Set().Difference(image).Empty() || !image.Difference(rest.Set()).Empty() {
+		t.Fatalf("expected deployment-controller's non-scale fields to be left untouched, got %v", otherFields)
+	}
+
+	// Simulate an HPA apply losing spec.replicas to a new manager, as a
+	// force-conflict merge would: deployment-controller's translated entry
+	// shrinks to empty and a new "hpa-controller" entry appears.
+	mergedScaleFields := fieldpath.ManagedFields{
+		"hpa-controller": fieldpath.NewVersionedSet(replicas, "autoscaling/v1", true),
+	}
+
+	parentFields := handler.FromScale(mergedScaleFields, otherFields)
+
+	if _, stillHasEntry := parentFields["deployment-controller"]; !stillHasEntry {
+		t.Fatalf("expected deployment-controller to keep its non-replica fields, got %v", parentFields)
+	}
+	if rest := parentFields["deployment-controller"].Set(); !rest.Difference(image).Empty() || !image.Difference(rest).Empty() {
+		t.Fatalf("expected deployment-controller to have lost spec.replicas but kept its image field, got %v", rest)
+	}
+	hpaEntry, ok := parentFields["hpa-controller"]
+	if !ok || hpaEntry.APIVersion() != "apps/v1" || !hpaEntry.Set().Difference(replicas).Empty() || !replicas.Difference(hpaEntry.Set()).Empty() {
+		t.Fatalf("expected hpa-controller's ownership of spec.replicas to be translated back to apps/v1, got %v", parentFields)
+	}
+}
+
+func TestSplitMainResourceFields(t *testing.T) {
+	fields := fieldpath.ManagedFields{
+		"main":  fieldpath.NewVersionedSet(fieldpath.NewSet(), "apps/v1", false),
+		"scale": fieldpath.NewVersionedSet(fieldpath.NewSet(), "autoscaling/v1", false),
+	}
+
+	matching, other := splitMainResourceFields(fields, schema.GroupVersion{Group: "apps", Version: "v1"})
+	if _, ok := matching["main"]; !ok || len(matching) != 1 {
+		t.Fatalf("expected only main to match apps/v1, got %v", matching)
+	}
+	if _, ok := other["scale"]; !ok || len(other) != 1 {
+		t.Fatalf("expected only scale to be left over, got %v", other)
+	}
+}
+
+// TestSplitMainResourceFieldsExcludesOtherSubresourcesSharingTheParentGV
+// verifies the bug ApplyToScale used to have: a manager that owns fields via
+// the parent's /status subresource shares the parent's own GroupVersion (as
+// virtually every subresource does), so GroupVersion alone can't tell it
+// apart from a genuine main-resource manager. Only a decoded
+// Subresource == "" entry may end up in mainResourceFields; otherwise its
+// fields would get fed into the /scale merge and could be force-taken by an
+// apply against an entirely unrelated subresource.
+func TestSplitMainResourceFieldsExcludesOtherSubresourcesSharingTheParentGV(t *testing.T) {
+	deploymentGV := deploymentGVK.GroupVersion()
+	mainID := buildManagerIdentifier(t, deploymentGV, "", "deployment-controller")
+	statusID := buildManagerIdentifier(t, deploymentGV, "status", "deployment-controller")
+
+	fields := fieldpath.ManagedFields{
+		mainID:   fieldpath.NewVersionedSet(fieldpath.NewSet(fieldpath.MakePathOrDie("spec", "replicas")), fieldpath.APIVersion(deploymentGV.String()), true),
+		statusID: fieldpath.NewVersionedSet(fieldpath.NewSet(fieldpath.MakePathOrDie("status", "replicas"), fieldpath.MakePathOrDie("status", "selector")), fieldpath.APIVersion(deploymentGV.String()), true),
+	}
+
+	matching, other := splitMainResourceFields(fields, deploymentGV)
+	if _, ok := matching[mainID]; !ok || len(matching) != 1 {
+		t.Fatalf("expected only the main-resource entry to match, got %v", matching)
+	}
+	if _, ok := other[statusID]; !ok || len(other) != 1 {
+		t.Fatalf("expected the /status entry to be left over despite sharing the parent's GroupVersion, got %v", other)
+	}
+}
+
+func TestSplitByKeys(t *testing.T) {
+	fields := fieldpath.ManagedFields{
+		"a": fieldpath.NewVersionedSet(fieldpath.NewSet(), "apps/v1", false),
+		"b": fieldpath.NewVersionedSet(fieldpath.NewSet(), "apps/v1", false),
+	}
+	keys := fieldpath.ManagedFields{"a": fields["a"]}
+
+	matching, other := splitByKeys(fields, keys)
+	if _, ok := matching["a"]; !ok || len(matching) != 1 {
+		t.Fatalf("expected only a to match, got %v", matching)
+	}
+	if _, ok := other["b"]; !ok || len(other) != 1 {
+		t.Fatalf("expected only b to be left over, got %v", other)
+	}
+}
+
+// newTestScaleFieldManager builds a *fieldManager equivalent to what
+// NewScaleFieldManager returns, but using internal.DeducedTypeConverter{}
+// instead of an openapi-models-backed one, so the test doesn't need a
+// models fixture to drive a real merge.
+func newTestScaleFieldManager(t *testing.T, parentGVK schema.GroupVersionKind) *fieldManager {
+	t.Helper()
+	typeConverter := internal.DeducedTypeConverter{}
+	converter := identityObjectConvertor{}
+	scaleGV := scaleGroupVersionKind.GroupVersion()
+	return &fieldManager{
+		typeConverter:   typeConverter,
+		objectConverter: converter,
+		objectDefaulter: pausedDefaulter{},
+		groupVersion:    scaleGV,
+		hubVersion:      scaleGV,
+		updater: merge.Updater{
+			Converter: internal.NewCRDVersionConverter(typeConverter, converter, scaleGV),
+		},
+		subresource:        "scale",
+		managedFieldsStore: inlineManagedFieldsStore{},
+		scaleParentGVK:     parentGVK,
+	}
+}
+
+// buildManagerIdentifier encodes a manager identifier the same way
+// buildManagerInfo would for a FieldManager scoped to gv/subresource, so
+// tests can seed parentManagedFields with realistic keys instead of
+// hand-rolled strings that splitFieldsBySubresource/DecodeManagerIdentifier
+// wouldn't recognize.
+func buildManagerIdentifier(t *testing.T, gv schema.GroupVersion, subresource, manager string) string {
+	t.Helper()
+	f := &fieldManager{groupVersion: gv, subresource: subresource}
+	id, err := f.buildManagerInfo(manager, metav1.ManagedFieldsOperationApply)
+	if err != nil {
+		t.Fatalf("failed to build manager identifier for %q: %v", manager, err)
+	}
+	return id
+}
+
+// findManagerEntry looks up fields' entry for manager by decoding every key,
+// since ApplyToScale's output is keyed by the identifiers buildManagerInfo
+// produces, not by the bare manager name.
+func findManagerEntry(fields fieldpath.ManagedFields, manager string) (string, fieldpath.VersionedSet, bool) {
+	for key, vs := range fields {
+		if entry, err := internal.DecodeManagerIdentifier(key); err == nil && entry.Manager == manager {
+			return key, vs, true
+		}
+	}
+	return "", nil, false
+}
+
+// TestApplyToScaleMirrorsReplicaOwnershipOntoParent drives ApplyToScale
+// through a real merge: an HPA applies to /scale and takes spec.replicas
+// away from deployment-controller, and the resulting managedFields written
+// back onto the parent must reflect that transfer, keep deployment-controller's
+// unrelated field under its original apps/v1 identity, record hpa-controller's
+// brand-new ownership as a "scale"-subresource entry (it never owned anything
+// under the parent GVK to translate back), and stamp a Times entry for the
+// manager that just wrote, the same way every other mutation path in this
+// package does.
+func TestApplyToScaleMirrorsReplicaOwnershipOntoParent(t *testing.T) {
+	replicas := fieldpath.NewSet(fieldpath.MakePathOrDie("spec", "replicas"))
+	image := fieldpath.NewSet(fieldpath.MakePathOrDie("spec", "template", "spec", "image"))
+	deploymentGV := deploymentGVK.GroupVersion()
+
+	deploymentControllerID := buildManagerIdentifier(t, deploymentGV, "", "deployment-controller")
+	deploymentControllerTime := &metav1.Time{Time: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	parentManagedFields := internal.Metadata{
+		Fields: fieldpath.ManagedFields{
+			deploymentControllerID: fieldpath.NewVersionedSet(replicas.Union(image), fieldpath.APIVersion(deploymentGV.String()), true),
+		},
+		Times: map[string]*metav1.Time{
+			deploymentControllerID: deploymentControllerTime,
+		},
+	}
+
+	fm := newTestScaleFieldManager(t, deploymentGVK)
+
+	liveScale := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "autoscaling/v1",
+		"kind":       "Scale",
+		"metadata":   map[string]interface{}{"name": "my-deploy"},
+		"spec":       map[string]interface{}{"replicas": int64(3)},
+	}}
+	patch := []byte(`{"apiVersion":"autoscaling/v1","kind":"Scale","spec":{"replicas":5}}`)
+
+	newObj, parentFields, err := fm.ApplyToScale(liveScale, patch, "hpa-controller", true, parentManagedFields)
+	if err != nil {
+		t.Fatalf("ApplyToScale failed: %v", err)
+	}
+
+	scaleObj, ok := newObj.(*unstructured.Unstructured)
+	if !ok {
+		t.Fatalf("expected *unstructured.Unstructured, got %T", newObj)
+	}
+	if got, _, _ := unstructured.NestedInt64(scaleObj.Object, "spec", "replicas"); got != 5 {
+		t.Fatalf("expected the merged Scale object to have spec.replicas=5, got %d", got)
+	}
+
+	scaleGV := scaleGroupVersionKind.GroupVersion()
+	hpaKey, hpaSet, ok := findManagerEntry(parentFields.Fields, "hpa-controller")
+	if !ok {
+		t.Fatalf("expected hpa-controller to appear in the fields written back onto the parent, got %v", parentFields.Fields)
+	}
+	if hpaSet.APIVersion() != fieldpath.APIVersion(scaleGV.String()) {
+		t.Fatalf("expected hpa-controller's brand-new ownership to stay recorded against %s (it never owned anything under the parent GVK), got %s", scaleGV, hpaSet.APIVersion())
+	}
+	if entry, err := internal.DecodeManagerIdentifier(hpaKey); err != nil || entry.Subresource != "scale" {
+		t.Fatalf("expected hpa-controller's entry to carry the \"scale\" subresource label, got %+v (err=%v)", entry, err)
+	}
+	if rest := hpaSet.Set().Difference(replicas); !rest.Empty() || !replicas.Difference(hpaSet.Set()).Empty() {
+		t.Fatalf("expected hpa-controller to own exactly spec.replicas on the parent, got %v", hpaSet.Set())
+	}
+	if _, ok := parentFields.Times[hpaKey]; !ok {
+		t.Fatalf("expected ApplyToScale to stamp a Times entry for hpa-controller's manager identifier, got %v", parentFields.Times)
+	}
+
+	deployEntry, ok := parentFields.Fields[deploymentControllerID]
+	if !ok {
+		t.Fatalf("expected deployment-controller to keep its non-replica fields, got %v", parentFields.Fields)
+	}
+	if rest := deployEntry.Set(); !rest.Difference(image).Empty() || !image.Difference(rest).Empty() {
+		t.Fatalf("expected deployment-controller to have lost spec.replicas but kept its image field, got %v", rest)
+	}
+	if got := parentFields.Times[deploymentControllerID]; got != deploymentControllerTime {
+		t.Fatalf("expected deployment-controller's existing Times entry to be preserved untouched, got %v", got)
+	}
+}
+
+// TestApplyToScaleDoesNotLeakStatusSubresourceOwnership drives ApplyToScale
+// through a real merge where, alongside the main-resource manager, a
+// /status manager owns status.replicas and status.selector under the
+// parent's own GroupVersion (as a real /status manager virtually always
+// does). An HPA force-applying to /scale must not be able to take those
+// fields away from the /status manager: they belong to an entirely
+// different subresource and should come back out untouched.
+func TestApplyToScaleDoesNotLeakStatusSubresourceOwnership(t *testing.T) {
+	replicas := fieldpath.NewSet(fieldpath.MakePathOrDie("spec", "replicas"))
+	statusFields := fieldpath.NewSet(fieldpath.MakePathOrDie("status", "replicas"), fieldpath.MakePathOrDie("status", "selector"))
+	deploymentGV := deploymentGVK.GroupVersion()
+
+	deploymentControllerID := buildManagerIdentifier(t, deploymentGV, "", "deployment-controller")
+	statusControllerID := buildManagerIdentifier(t, deploymentGV, "status", "deployment-controller")
+
+	parentManagedFields := internal.Metadata{
+		Fields: fieldpath.ManagedFields{
+			deploymentControllerID: fieldpath.NewVersionedSet(replicas, fieldpath.APIVersion(deploymentGV.String()), true),
+			statusControllerID:     fieldpath.NewVersionedSet(statusFields, fieldpath.APIVersion(deploymentGV.String()), true),
+		},
+		Times: map[string]*metav1.Time{},
+	}
+
+	fm := newTestScaleFieldManager(t, deploymentGVK)
+
+	liveScale := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "autoscaling/v1",
+		"kind":       "Scale",
+		"metadata":   map[string]interface{}{"name": "my-deploy"},
+		"spec":       map[string]interface{}{"replicas": int64(3)},
+	}}
+	patch := []byte(`{"apiVersion":"autoscaling/v1","kind":"Scale","spec":{"replicas":5}}`)
+
+	_, parentFields, err := fm.ApplyToScale(liveScale, patch, "hpa-controller", true, parentManagedFields)
+	if err != nil {
+		t.Fatalf("ApplyToScale failed: %v", err)
+	}
+
+	statusEntry, ok := parentFields.Fields[statusControllerID]
+	if !ok {
+		t.Fatalf("expected the /status manager's entry to survive untouched, got %v", parentFields.Fields)
+	}
+	if rest := statusEntry.Set(); !rest.Difference(statusFields).Empty() || !statusFields.Difference(rest).Empty() {
+		t.Fatalf("expected the /status manager to still own exactly %v, got %v", statusFields, rest)
+	}
+	if entry, err := internal.DecodeManagerIdentifier(statusControllerID); err != nil || entry.Subresource != "status" {
+		t.Fatalf("expected the /status manager's entry to keep its \"status\" subresource label, got %+v (err=%v)", entry, err)
+	}
+}
+
+// TestApplyToScaleRunsDefaulting verifies that ApplyToScale defaults the
+// merged Scale object the same way Apply does for the main resource, and
+// attributes whatever the defaulter fills in to defaulterManager scoped to
+// the "scale" subresource, instead of silently skipping defaulting on this
+// path.
+func TestApplyToScaleRunsDefaulting(t *testing.T) {
+	fm := newTestScaleFieldManager(t, deploymentGVK)
+
+	parentManagedFields := internal.Metadata{
+		Fields: fieldpath.ManagedFields{},
+		Times:  map[string]*metav1.Time{},
+	}
+
+	liveScale := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "autoscaling/v1",
+		"kind":       "Scale",
+		"metadata":   map[string]interface{}{"name": "my-deploy"},
+		"spec":       map[string]interface{}{"replicas": int64(3)},
+	}}
+	patch := []byte(`{"apiVersion":"autoscaling/v1","kind":"Scale","spec":{"replicas":5}}`)
+
+	newObj, parentFields, err := fm.ApplyToScale(liveScale, patch, "hpa-controller", true, parentManagedFields)
+	if err != nil {
+		t.Fatalf("ApplyToScale failed: %v", err)
+	}
+
+	scaleObj, ok := newObj.(*unstructured.Unstructured)
+	if !ok {
+		t.Fatalf("expected *unstructured.Unstructured, got %T", newObj)
+	}
+	if paused, found, _ := unstructured.NestedBool(scaleObj.Object, "spec", "paused"); !found || paused {
+		t.Fatalf("expected the merged Scale object to carry the admission-defaulted spec.paused=false, got found=%v value=%v", found, paused)
+	}
+
+	defaulterSeen := false
+	for manager := range parentFields.Fields {
+		if entry, err := internal.DecodeManagerIdentifier(manager); err == nil && entry.Manager == defaulterManager && entry.Subresource == "scale" {
+			defaulterSeen = true
+		}
+	}
+	if !defaulterSeen {
+		t.Fatalf("expected %s to show up scoped to the scale subresource, got %v", defaulterManager, parentFields.Fields)
+	}
+}